@@ -2,6 +2,9 @@ package tfawsresource
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/terraform-plugin-sdk/helper/resource"
@@ -138,3 +141,598 @@ func TestCheckTypeSetElemAttr(res, attr, value string) resource.TestCheckFunc {
 		return fmt.Errorf("%q no TypeSet element %q, with value %q in state: %#v", res, attr, value, is.Attributes)
 	}
 }
+
+// TestMatchTypeSetElemNestedAttrs is a resource.TestCheckFunc that accepts a resource
+// name, an attribute path, which should use the sentinel value '*' for indexing
+// into a TypeSet. The function verifies that an element matches the whole value
+// map of regular expressions.
+//
+// You may check for unset keys, however this will also match keys set to empty
+// string. Please provide a map with at least 1 non-empty value.
+//
+//   map[string]*regexp.Regexp{
+//	     "key1": regexp.MustCompile("value"),
+//       "key2": regexp.MustCompile(""),
+//   }
+//
+// Use this function over SDK provided TestCheckFunctions when validating a
+// TypeSet where its elements are a nested object with their own attrs/values,
+// and the values are not known ahead of time.
+//
+// Please note, if the provided value map is not granular enough, there exists
+// the possibility you match an element you were not intending to, in the TypeSet.
+// Provide a full mapping of attributes to be sure the unique element exists.
+func TestMatchTypeSetElemNestedAttrs(res, attr string, values map[string]*regexp.Regexp) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		matches := make(map[string]int)
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+		// account for cases where the user is trying to see if the value is unset/empty
+		// there may be ambiguous scenarios where a field was deliberately unset vs set
+		// to the empty string, this will match both, which may be a false positive.
+		var matchCount int
+		for _, v := range values {
+			if v.String() != "" {
+				matchCount++
+			}
+		}
+		if matchCount == 0 {
+			return fmt.Errorf("%#v has no non-empty values", values)
+		}
+		for stateKey, stateValue := range is.Attributes {
+			stateKeyParts := strings.Split(stateKey, ".")
+			// a Set/List item with nested attrs would have a flatmap address of
+			// at least length 3
+			// foo.0.name = "bar"
+			if len(stateKeyParts) < 3 {
+				continue
+			}
+			var pathMatch bool
+			for i := range attrParts {
+				if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+					break
+				}
+				if i == len(attrParts)-1 {
+					pathMatch = true
+				}
+			}
+			if !pathMatch {
+				continue
+			}
+			id := stateKeyParts[len(attrParts)-1]
+			nestedAttr := strings.Join(stateKeyParts[len(attrParts):], ".")
+			// an empty pattern only matches an empty value, as in TestCheckTypeSetElemNestedAttrs
+			if v, keyExists := values[nestedAttr]; keyExists && (v.String() != "" || stateValue == "") && v.MatchString(stateValue) {
+				matches[id] = matches[id] + 1
+				if matches[id] == matchCount {
+					return nil
+				}
+			}
+		}
+
+		return fmt.Errorf("%q no TypeSet element %q, with nested attrs matching %#v in state: %#v", res, attr, values, is.Attributes)
+	}
+}
+
+// TestMatchTypeSetElemAttr is a resource.TestCheckFunc that accepts a resource
+// name, an attribute path, which should use the sentinel value '*' for indexing
+// into a TypeSet. The function verifies that an element matches the provided
+// regular expression.
+//
+// Use this function over SDK provided TestCheckFunctions when validating a
+// TypeSet where its elements are a simple value whose contents are generated
+// (an ID, ARN, or timestamp for example), and not known ahead of time.
+func TestMatchTypeSetElemAttr(res, attr string, r *regexp.Regexp) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+		for stateKey, stateValue := range is.Attributes {
+			if r.MatchString(stateValue) {
+				stateKeyParts := strings.Split(stateKey, ".")
+				// skip the element count entry, e.g. foo.#
+				if len(stateKeyParts) == len(attrParts) && stateKeyParts[len(stateKeyParts)-1] != "#" {
+					for i := range attrParts {
+						if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+							break
+						}
+						if i == len(attrParts)-1 {
+							return nil
+						}
+					}
+				}
+			}
+		}
+
+		return fmt.Errorf("%q no TypeSet element %q, matching %q in state: %#v", res, attr, r.String(), is.Attributes)
+	}
+}
+
+// TestCheckTypeSetElemAttrWith is a resource.TestCheckFunc that accepts a
+// resource name, an attribute path, which should use the sentinel value '*'
+// for indexing into a TypeSet, and a predicate function. The function passes
+// if the predicate returns a nil error for at least one of the matching
+// TypeSet elements.
+//
+// Use this function over SDK provided TestCheckFunctions when validating a
+// TypeSet where its elements are a simple value that cannot be checked via
+// exact match or regular expression, such as a value that must be parsed
+// before being validated.
+func TestCheckTypeSetElemAttrWith(res, attr string, check func(value string) error) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+		for stateKey, stateValue := range is.Attributes {
+			stateKeyParts := strings.Split(stateKey, ".")
+			// skip the element count entry, e.g. foo.#
+			if len(stateKeyParts) != len(attrParts) || stateKeyParts[len(stateKeyParts)-1] == "#" {
+				continue
+			}
+			var pathMatch bool
+			for i := range attrParts {
+				if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+					break
+				}
+				if i == len(attrParts)-1 {
+					pathMatch = true
+				}
+			}
+			if !pathMatch {
+				continue
+			}
+			if err := check(stateValue); err == nil {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%q no TypeSet element %q, matching the predicate in state: %#v", res, attr, is.Attributes)
+	}
+}
+
+// TestCheckTypeSetElemNestedAttrsWith is a resource.TestCheckFunc that
+// accepts a resource name, an attribute path, which should use the sentinel
+// value '*' for indexing into a TypeSet, and a predicate function. The
+// predicate receives the full set of nested attribute values for a single
+// TypeSet element, and the function passes if it returns a nil error for at
+// least one element.
+//
+// Use this function over SDK provided TestCheckFunctions when validating a
+// TypeSet where its elements are a nested object, and the assertion cannot be
+// expressed as an exact match or regular expression against individual
+// attrs, such as a cross-attribute invariant on a single element.
+func TestCheckTypeSetElemNestedAttrsWith(res, attr string, check func(values map[string]string) error) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+
+		elements := make(map[string]map[string]string)
+		for stateKey, stateValue := range is.Attributes {
+			stateKeyParts := strings.Split(stateKey, ".")
+			// a Set/List item with nested attrs would have a flatmap address of
+			// at least length 3
+			// foo.0.name = "bar"
+			if len(stateKeyParts) < 3 {
+				continue
+			}
+			var pathMatch bool
+			for i := range attrParts {
+				if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+					break
+				}
+				if i == len(attrParts)-1 {
+					pathMatch = true
+				}
+			}
+			if !pathMatch {
+				continue
+			}
+			id := stateKeyParts[len(attrParts)-1]
+			nestedAttr := strings.Join(stateKeyParts[len(attrParts):], ".")
+			if elements[id] == nil {
+				elements[id] = make(map[string]string)
+			}
+			elements[id][nestedAttr] = stateValue
+		}
+
+		for _, values := range elements {
+			if err := check(values); err == nil {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("%q no TypeSet element %q, matching the predicate in state: %#v", res, attr, is.Attributes)
+	}
+}
+
+// TestCheckTypeListAttrSorted is a resource.TestCheckFunc that accepts a
+// resource name, an attribute path, which should use the sentinel value '*'
+// for indexing into a TypeList, and an order, either "asc" or "desc". The
+// function collects the state values at the given path in index order and
+// verifies that they are monotonically ordered using natural string
+// comparison.
+//
+// Use this function to assert the documented sort order of a TypeList
+// attribute, such as the AZs returned by aws_availability_zones or a
+// resource's sorted tag list.
+func TestCheckTypeListAttrSorted(res, attr, order string) resource.TestCheckFunc {
+	return TestCheckTypeListAttrSortedBy(res, attr, order, func(a, b string) bool { return a < b })
+}
+
+// TestCheckTypeListAttrSortedBy is a resource.TestCheckFunc that accepts a
+// resource name, an attribute path, which should use the sentinel value '*'
+// for indexing into a TypeList, an order, either "asc" or "desc", and a
+// custom less function. The function collects the state values at the given
+// path in index order and verifies that they are monotonically ordered
+// according to less.
+//
+// Use this variant over TestCheckTypeListAttrSorted when natural string
+// comparison is not the right notion of order, such as numeric or timestamp
+// values.
+func TestCheckTypeListAttrSortedBy(res, attr, order string, less func(a, b string) bool) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if order != "asc" && order != "desc" {
+			return fmt.Errorf("%q is not a valid order, must be %q or %q", order, "asc", "desc")
+		}
+
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+		sentinelPos := len(attrParts) - 1
+
+		indices := make([]int, 0)
+		values := make(map[int]string)
+		for stateKey, stateValue := range is.Attributes {
+			stateKeyParts := strings.Split(stateKey, ".")
+			if len(stateKeyParts) != len(attrParts) {
+				continue
+			}
+			var pathMatch = true
+			for i := 0; i < sentinelPos; i++ {
+				if attrParts[i] != stateKeyParts[i] {
+					pathMatch = false
+					break
+				}
+			}
+			if !pathMatch {
+				continue
+			}
+			index, err := strconv.Atoi(stateKeyParts[sentinelPos])
+			if err != nil {
+				continue
+			}
+			indices = append(indices, index)
+			values[index] = stateValue
+		}
+
+		if len(indices) == 0 {
+			return fmt.Errorf("%q no TypeList elements found for %q in state: %#v", res, attr, is.Attributes)
+		}
+
+		sort.Ints(indices)
+		ordered := make([]string, len(indices))
+		for i, index := range indices {
+			ordered[i] = values[index]
+		}
+
+		for i := 1; i < len(ordered); i++ {
+			switch order {
+			case "asc":
+				if less(ordered[i], ordered[i-1]) {
+					return fmt.Errorf("%q attribute %q is not sorted ascending: %#v", res, attr, ordered)
+				}
+			case "desc":
+				if less(ordered[i-1], ordered[i]) {
+					return fmt.Errorf("%q attribute %q is not sorted descending: %#v", res, attr, ordered)
+				}
+			}
+		}
+
+		return nil
+	}
+}
+
+// TestCheckTypeSetElemNestedAttrsCount is a resource.TestCheckFunc that
+// accepts a resource name, an attribute path, which should use the sentinel
+// value '*' for indexing into a TypeSet, a value map, and an expected count.
+// It reuses the same path/match logic as TestCheckTypeSetElemNestedAttrs, but
+// instead of returning on the first match, it walks the entire state and
+// asserts that exactly expectedCount distinct TypeSet elements match the
+// supplied value map.
+//
+// Use this function over TestCheckTypeSetElemNestedAttrs when a TypeSet is
+// expected to contain more than one element matching the same value map,
+// such as a set of rules or ENIs that are generated in a loop.
+func TestCheckTypeSetElemNestedAttrsCount(res, attr string, values map[string]string, expectedCount int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		matches := make(map[string]int)
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+		// account for cases where the user is trying to see if the value is unset/empty
+		// there may be ambiguous scenarios where a field was deliberately unset vs set
+		// to the empty string, this will match both, which may be a false positive.
+		var matchCount int
+		for _, v := range values {
+			if v != "" {
+				matchCount++
+			}
+		}
+		if matchCount == 0 {
+			return fmt.Errorf("%#v has no non-empty values", values)
+		}
+		for stateKey, stateValue := range is.Attributes {
+			stateKeyParts := strings.Split(stateKey, ".")
+			// a Set/List item with nested attrs would have a flatmap address of
+			// at least length 3
+			// foo.0.name = "bar"
+			if len(stateKeyParts) < 3 {
+				continue
+			}
+			var pathMatch bool
+			for i := range attrParts {
+				if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+					break
+				}
+				if i == len(attrParts)-1 {
+					pathMatch = true
+				}
+			}
+			if !pathMatch {
+				continue
+			}
+			id := stateKeyParts[len(attrParts)-1]
+			nestedAttr := strings.Join(stateKeyParts[len(attrParts):], ".")
+			if v, keyExists := values[nestedAttr]; keyExists && v == stateValue {
+				matches[id] = matches[id] + 1
+			}
+		}
+
+		var actualCount int
+		for _, count := range matches {
+			// keys given an empty value are not part of matchCount but are
+			// still counted as hits, so an element may exceed it
+			if count >= matchCount {
+				actualCount++
+			}
+		}
+		if actualCount != expectedCount {
+			return fmt.Errorf("%q expected %d TypeSet elements %q, with nested attrs %#v, got %d in state: %#v", res, expectedCount, attr, values, actualCount, is.Attributes)
+		}
+
+		return nil
+	}
+}
+
+// TestCheckTypeSetElemAttrUnique is a resource.TestCheckFunc that accepts a
+// resource name and an attribute path, which should use the sentinel value
+// '*' for indexing into a TypeSet. The function collects the values of the
+// scalar TypeSet attribute and fails if any duplicates are found.
+//
+// Use this function to assert that a TypeSet of simple values, such as a set
+// of tags or ENI IDs, does not contain duplicate elements.
+func TestCheckTypeSetElemAttrUnique(res, attr string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		ms := s.RootModule()
+		rs, ok := ms.Resources[res]
+		if !ok {
+			return fmt.Errorf("Not found: %s in %s", res, ms.Path)
+		}
+
+		is := rs.Primary
+		if is == nil {
+			return fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+		}
+
+		attrParts := strings.Split(attr, ".")
+		if attrParts[len(attrParts)-1] != sentinelIndex {
+			return fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+		}
+
+		seen := make(map[string]bool)
+		for stateKey, stateValue := range is.Attributes {
+			stateKeyParts := strings.Split(stateKey, ".")
+			// skip the element count entry, e.g. foo.#
+			if len(stateKeyParts) != len(attrParts) || stateKeyParts[len(stateKeyParts)-1] == "#" {
+				continue
+			}
+			var pathMatch bool
+			for i := range attrParts {
+				if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+					break
+				}
+				if i == len(attrParts)-1 {
+					pathMatch = true
+				}
+			}
+			if !pathMatch {
+				continue
+			}
+			if seen[stateValue] {
+				return fmt.Errorf("%q TypeSet element %q has duplicate value %q in state: %#v", res, attr, stateValue, is.Attributes)
+			}
+			seen[stateValue] = true
+		}
+
+		return nil
+	}
+}
+
+// ResolveTypeSetElemIndex runs the same path-walking and matching logic as
+// TestCheckTypeSetElemNestedAttrs, but instead of returning a
+// resource.TestCheckFunc, it returns the resolved flatmap prefix (e.g.
+// "rule.3827103921") for the matched element, so that callers can compose
+// with SDK helpers such as resource.TestCheckResourceAttrPair on deeply
+// nested attributes.
+func ResolveTypeSetElemIndex(s *terraform.State, res, attr string, match map[string]string) (string, error) {
+	ms := s.RootModule()
+	rs, ok := ms.Resources[res]
+	if !ok {
+		return "", fmt.Errorf("Not found: %s in %s", res, ms.Path)
+	}
+
+	is := rs.Primary
+	if is == nil {
+		return "", fmt.Errorf("No primary instance: %s in %s", res, ms.Path)
+	}
+
+	matches := make(map[string]int)
+	attrParts := strings.Split(attr, ".")
+	if attrParts[len(attrParts)-1] != sentinelIndex {
+		return "", fmt.Errorf("%q does not end with the special value %q", attr, sentinelIndex)
+	}
+	// account for cases where the user is trying to see if the value is unset/empty
+	// there may be ambiguous scenarios where a field was deliberately unset vs set
+	// to the empty string, this will match both, which may be a false positive.
+	var matchCount int
+	for _, v := range match {
+		if v != "" {
+			matchCount++
+		}
+	}
+	if matchCount == 0 {
+		return "", fmt.Errorf("%#v has no non-empty values", match)
+	}
+	for stateKey, stateValue := range is.Attributes {
+		stateKeyParts := strings.Split(stateKey, ".")
+		// a Set/List item with nested attrs would have a flatmap address of
+		// at least length 3
+		// foo.0.name = "bar"
+		if len(stateKeyParts) < 3 {
+			continue
+		}
+		var pathMatch bool
+		for i := range attrParts {
+			if attrParts[i] != stateKeyParts[i] && attrParts[i] != sentinelIndex {
+				break
+			}
+			if i == len(attrParts)-1 {
+				pathMatch = true
+			}
+		}
+		if !pathMatch {
+			continue
+		}
+		id := stateKeyParts[len(attrParts)-1]
+		nestedAttr := strings.Join(stateKeyParts[len(attrParts):], ".")
+		if v, keyExists := match[nestedAttr]; keyExists && v == stateValue {
+			matches[id] = matches[id] + 1
+			if matches[id] == matchCount {
+				return strings.Join(append(attrParts[:len(attrParts)-1], id), "."), nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("%q no TypeSet element %q, with nested attrs %#v in state: %#v", res, attr, match, is.Attributes)
+}
+
+// TestCheckTypeSetElemAttrPair is a resource.TestCheckFunc that accepts two
+// resource names and two attribute paths, the first of which should use the
+// sentinel value '*' for indexing into a TypeSet, and asserts that the
+// scalar value inside the matched TypeSet element on the first resource
+// equals the attribute on the second resource.
+//
+// Use this function over SDK provided TestCheckFunctions such as
+// resource.TestCheckResourceAttrPair when one side of the comparison lives
+// inside a TypeSet whose element index is not deterministic, such as
+// security group rules, IAM policy statements, or NLB/ALB listeners.
+func TestCheckTypeSetElemAttrPair(res1, attr1, res2, attr2 string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		attrParts := strings.Split(attr1, ".")
+		if len(attrParts) < 2 || attrParts[len(attrParts)-2] != sentinelIndex {
+			return fmt.Errorf("%q does not contain the special value %q as its second-to-last part", attr1, sentinelIndex)
+		}
+		leaf := attrParts[len(attrParts)-1]
+		setAttr := strings.Join(attrParts[:len(attrParts)-1], ".")
+
+		ms := s.RootModule()
+		rs2, ok := ms.Resources[res2]
+		if !ok || rs2.Primary == nil {
+			return fmt.Errorf("Not found: %s in %s", res2, ms.Path)
+		}
+		attrValue2, ok := rs2.Primary.Attributes[attr2]
+		if !ok {
+			return fmt.Errorf("%s: Attribute %q not found", res2, attr2)
+		}
+
+		if _, err := ResolveTypeSetElemIndex(s, res1, setAttr, map[string]string{leaf: attrValue2}); err != nil {
+			return err
+		}
+
+		return nil
+	}
+}